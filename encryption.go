@@ -0,0 +1,289 @@
+package swiftds
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	swift "github.com/ncw/swift/v2"
+)
+
+const (
+	// AlgAES256GCM is the default client-side encryption algorithm.
+	AlgAES256GCM = "aes-256-gcm"
+
+	// AlgChaCha20Poly1305 is an alternative client-side encryption
+	// algorithm, useful on platforms without AES hardware acceleration.
+	AlgChaCha20Poly1305 = "chacha20-poly1305"
+
+	// encHeaderName carries "<algorithm>:<keyID>" on every object
+	// encrypted by this package, so Get/Query/Rewrap know how to
+	// decrypt it without guessing.
+	encHeaderName = "X-Object-Meta-Swiftds-Enc"
+)
+
+// EncryptionConfig opts the datastore into transparent client-side
+// encryption of object contents. Swift containers are typically shared
+// storage, and most providers don't offer per-tenant keys for
+// encryption-at-rest, so this trades a little CPU for contents that are
+// unreadable without the configured key.
+type EncryptionConfig struct {
+	// Algorithm selects the AEAD cipher: AlgAES256GCM (the default, used
+	// when empty) or AlgChaCha20Poly1305.
+	Algorithm string
+
+	// KeyBytes is the raw encryption key. Mutually exclusive with
+	// KeyFile. Must be 32 bytes for both supported algorithms.
+	KeyBytes []byte
+
+	// KeyFile, if set, names a file holding the raw key. It is read once,
+	// at datastore construction. Mutually exclusive with KeyBytes.
+	KeyFile string
+
+	// KeyID is an opaque label recorded alongside Algorithm in each
+	// object's encHeaderName header, so a later Rewrap (or an operator
+	// reading HEAD output) can tell which key encrypted it.
+	KeyID string
+}
+
+func (c EncryptionConfig) enabled() bool {
+	return len(c.KeyBytes) > 0 || c.KeyFile != ""
+}
+
+// encryptor seals and opens object values with an AEAD cipher, prefixing
+// ciphertext with a fresh random nonce on every seal: nonce || ciphertext
+// || tag.
+type encryptor struct {
+	alg   string
+	keyID string
+	aead  cipher.AEAD
+}
+
+func newEncryptor(conf EncryptionConfig) (*encryptor, error) {
+	if !conf.enabled() {
+		return nil, nil
+	}
+
+	if len(conf.KeyBytes) > 0 && conf.KeyFile != "" {
+		return nil, fmt.Errorf("swiftds: Encryption.KeyBytes and Encryption.KeyFile are mutually exclusive")
+	}
+
+	key := conf.KeyBytes
+	if conf.KeyFile != "" {
+		b, err := os.ReadFile(conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("swiftds: reading Encryption.KeyFile: %w", err)
+		}
+		key = b
+	}
+
+	alg := conf.Algorithm
+	if alg == "" {
+		alg = AlgAES256GCM
+	}
+
+	aead, err := newAEAD(alg, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryptor{alg: alg, keyID: conf.KeyID, aead: aead}, nil
+}
+
+func newAEAD(alg string, key []byte) (cipher.AEAD, error) {
+	switch alg {
+	case AlgAES256GCM:
+		if len(key) != 32 {
+			return nil, fmt.Errorf("swiftds: %s key must be 32 bytes, got %d", alg, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("swiftds: %s key: %w", alg, err)
+		}
+		return cipher.NewGCM(block)
+	case AlgChaCha20Poly1305:
+		return chacha20poly1305.New(key)
+	default:
+		return nil, fmt.Errorf("swiftds: unknown Encryption.Algorithm %q", alg)
+	}
+}
+
+func (e *encryptor) overhead() int {
+	return e.aead.NonceSize() + e.aead.Overhead()
+}
+
+func (e *encryptor) seal(val []byte) ([]byte, error) {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return e.aead.Seal(nonce, nonce, val, nil), nil
+}
+
+func (e *encryptor) open(data []byte) ([]byte, error) {
+	n := e.aead.NonceSize()
+	if len(data) < n {
+		return nil, fmt.Errorf("swiftds: encrypted object shorter than a nonce")
+	}
+	nonce, ciphertext := data[:n], data[n:]
+	return e.aead.Open(nil, nonce, ciphertext, nil)
+}
+
+func (e *encryptor) header() swift.Headers {
+	return swift.Headers{encHeaderName: e.alg + ":" + e.keyID}
+}
+
+// parseEncHeader reports whether headers carry an encHeaderName value and,
+// if so, splits it back into algorithm and key ID.
+func parseEncHeader(headers swift.Headers) (alg, keyID string, ok bool) {
+	v := headers[encHeaderName]
+	if v == "" {
+		return "", "", false
+	}
+	alg, keyID, ok = strings.Cut(v, ":")
+	return alg, keyID, ok
+}
+
+// getObject fetches and, if the object carries an encHeaderName header,
+// decrypts name's contents. Shared by Get and Query so both decrypt the
+// same way.
+func (s *SwiftContainer) getObject(ctx context.Context, name string) ([]byte, error) {
+	rc, headers, err := s.conn.ObjectOpen(ctx, s.Container, name, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.maybeDecrypt(headers, data)
+}
+
+func (s *SwiftContainer) maybeDecrypt(headers swift.Headers, data []byte) ([]byte, error) {
+	alg, keyID, ok := parseEncHeader(headers)
+	if !ok {
+		return data, nil
+	}
+
+	if s.encryptor == nil {
+		return nil, fmt.Errorf("swiftds: object is encrypted (key %q) but Config.Encryption is not set", keyID)
+	}
+	if alg != s.encryptor.alg {
+		return nil, fmt.Errorf("swiftds: object was encrypted with %q, but configured for %q", alg, s.encryptor.alg)
+	}
+
+	return s.encryptor.open(data)
+}
+
+// Rewrap re-encrypts every object in the container under newKey, for
+// offline rotation away from oldKey. It streams through ObjectNames
+// pagination, holding at most one object in memory at a time, and leaves
+// unencrypted objects untouched. It stops with an error at the first object
+// encrypted under a different algorithm than Config.Encryption's; objects
+// rewrapped before that point stay under newKey. Config.Encryption must
+// already be set, since it determines
+// the algorithm and the KeyID recorded on rewrapped objects.
+func (s *SwiftContainer) Rewrap(ctx context.Context, oldKey, newKey []byte) error {
+	if s.encryptor == nil {
+		return fmt.Errorf("swiftds: Rewrap requires Config.Encryption to be set")
+	}
+
+	oldAEAD, err := newAEAD(s.encryptor.alg, oldKey)
+	if err != nil {
+		return err
+	}
+	newAEAD, err := newAEAD(s.encryptor.alg, newKey)
+	if err != nil {
+		return err
+	}
+
+	oldEnc := &encryptor{alg: s.encryptor.alg, keyID: s.encryptor.keyID, aead: oldAEAD}
+	newEnc := &encryptor{alg: s.encryptor.alg, keyID: s.encryptor.keyID, aead: newAEAD}
+
+	opts := swift.ObjectsOpts{Limit: 10000}
+	for {
+		names, err := s.conn.ObjectNames(ctx, s.Container, &opts)
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			return nil
+		}
+
+		for _, name := range names {
+			if err := s.rewrapOne(ctx, name, oldEnc, newEnc); err != nil {
+				return fmt.Errorf("swiftds: rewrap %q: %w", name, err)
+			}
+		}
+
+		if len(names) < opts.Limit {
+			return nil
+		}
+		opts.Marker = names[len(names)-1]
+	}
+}
+
+func (s *SwiftContainer) rewrapOne(ctx context.Context, name string, oldEnc, newEnc *encryptor) error {
+	// ObjectOpen transparently reassembles large-object segments, so this
+	// reads the same stored ciphertext whether name is a plain object or a large
+	// object's manifest. Only the headers on the manifest carry
+	// encHeaderName and the large-object markers, which is why both are
+	// read from the same Object call below rather than from ObjectOpen.
+	_, headers, err := s.conn.Object(ctx, s.Container, name)
+	if err != nil {
+		return err
+	}
+
+	alg, _, ok := parseEncHeader(headers)
+	if !ok {
+		return nil
+	}
+	if alg != oldEnc.alg {
+		return fmt.Errorf("object encrypted with unexpected algorithm %q", alg)
+	}
+
+	rc, _, err := s.conn.ObjectOpen(ctx, s.Container, name, true, nil)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+
+	plain, err := oldEnc.open(data)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := newEnc.seal(plain)
+	if err != nil {
+		return err
+	}
+
+	if headers.IsLargeObject() {
+		// Re-segment rather than flattening into one PUT: a resealed large
+		// object can still exceed Swift's 5 GiB single-object limit, and a
+		// flat PUT over the old manifest would orphan its segments forever.
+		newHeaders := newEnc.header()
+		if headers.IsLargeObjectDLO() {
+			return s.putDynamicLargeObject(ctx, name, sealed, newHeaders)
+		}
+		return s.putStaticLargeObject(ctx, name, sealed, newHeaders)
+	}
+
+	_, err = s.conn.ObjectPut(ctx, s.Container, name, bytes.NewReader(sealed), false, "", "application/octet-stream", newEnc.header())
+	return err
+}
@@ -0,0 +1,183 @@
+package swiftds
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+func TestEncryptorSealOpenRoundTrip(t *testing.T) {
+	for _, alg := range []string{AlgAES256GCM, AlgChaCha20Poly1305} {
+		key := make([]byte, 32)
+		for i := range key {
+			key[i] = byte(i)
+		}
+
+		enc, err := newEncryptor(EncryptionConfig{Algorithm: alg, KeyBytes: key, KeyID: "k1"})
+		if err != nil {
+			t.Fatalf("%s: newEncryptor: %v", alg, err)
+		}
+
+		plain := []byte("hello, swift datastore")
+		sealed, err := enc.seal(plain)
+		if err != nil {
+			t.Fatalf("%s: seal: %v", alg, err)
+		}
+
+		if bytes.Contains(sealed, plain) {
+			t.Fatalf("%s: ciphertext contains the plaintext", alg)
+		}
+
+		opened, err := enc.open(sealed)
+		if err != nil {
+			t.Fatalf("%s: open: %v", alg, err)
+		}
+
+		if !bytes.Equal(opened, plain) {
+			t.Fatalf("%s: got %q, want %q", alg, opened, plain)
+		}
+	}
+}
+
+func TestEncryptorHeaderRoundTrip(t *testing.T) {
+	enc, err := newEncryptor(EncryptionConfig{KeyBytes: make([]byte, 32), KeyID: "rotation-2026-07"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers := enc.header()
+	alg, keyID, ok := parseEncHeader(headers)
+	if !ok {
+		t.Fatal("expected encHeaderName to be set")
+	}
+	if alg != AlgAES256GCM {
+		t.Errorf("alg = %q, want %q", alg, AlgAES256GCM)
+	}
+	if keyID != "rotation-2026-07" {
+		t.Errorf("keyID = %q, want %q", keyID, "rotation-2026-07")
+	}
+}
+
+func TestNewEncryptorDisabled(t *testing.T) {
+	enc, err := newEncryptor(EncryptionConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enc != nil {
+		t.Fatal("expected nil encryptor when no key is configured")
+	}
+}
+
+func TestNewEncryptorRejectsBothKeySources(t *testing.T) {
+	_, err := newEncryptor(EncryptionConfig{KeyBytes: make([]byte, 32), KeyFile: "/tmp/doesnotmatter"})
+	if err == nil {
+		t.Fatal("expected an error when both KeyBytes and KeyFile are set")
+	}
+}
+
+func TestNewEncryptorRejectsWrongKeyLength(t *testing.T) {
+	for _, alg := range []string{AlgAES256GCM, AlgChaCha20Poly1305} {
+		if _, err := newEncryptor(EncryptionConfig{Algorithm: alg, KeyBytes: make([]byte, 16)}); err == nil {
+			t.Errorf("%s: expected an error for a 16-byte key", alg)
+		}
+	}
+}
+
+// TestRewrap covers both a plain object and a large one, so a rotation over
+// a mixed container doesn't flatten the large object's manifest and orphan
+// its segments (see putStaticLargeObject/putDynamicLargeObject).
+func TestRewrap(t *testing.T) {
+	for _, dynamic := range []bool{false, true} {
+		dynamic := dynamic
+		name := "static"
+		if dynamic {
+			name = "dynamic"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			oldKey := make([]byte, 32)
+			for i := range oldKey {
+				oldKey[i] = byte(i)
+			}
+			newKey := make([]byte, 32)
+			for i := range newKey {
+				newKey[i] = byte(i + 1)
+			}
+
+			d, done := newLargeObjectTestDS(t, func(c *Config) {
+				c.UseDynamicLargeObject = dynamic
+				c.Encryption = EncryptionConfig{KeyBytes: oldKey, KeyID: "k1"}
+			})
+			defer done()
+
+			ctx := context.Background()
+
+			smallKey := ds.NewKey("/small")
+			smallVal := []byte("hello, swift datastore")
+			if err := d.Put(ctx, smallKey, smallVal); err != nil {
+				t.Fatalf("Put small: %v", err)
+			}
+
+			bigKey := ds.NewKey("/big")
+			bigVal := make([]byte, 200)
+			if _, err := rand.Read(bigVal); err != nil {
+				t.Fatal(err)
+			}
+			if err := d.Put(ctx, bigKey, bigVal); err != nil {
+				t.Fatalf("Put big: %v", err)
+			}
+
+			segsBefore, err := d.conn.ObjectNamesAll(ctx, d.segmentsContainer(), nil)
+			if err != nil {
+				t.Fatalf("listing segments before Rewrap: %v", err)
+			}
+			if len(segsBefore) == 0 {
+				t.Fatal("expected Put to have written segments")
+			}
+
+			if err := d.Rewrap(ctx, oldKey, newKey); err != nil {
+				t.Fatalf("Rewrap: %v", err)
+			}
+
+			// Rewrap rotated the key in place, so reads through d's still
+			// oldKey-configured encryptor must now fail...
+			if _, err := d.Get(ctx, smallKey); err == nil {
+				t.Fatal("expected Get with the old key to fail after Rewrap")
+			}
+
+			// ...but succeed once d is pointed at newKey.
+			newEnc, err := newEncryptor(EncryptionConfig{KeyBytes: newKey, KeyID: "k1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.encryptor = newEnc
+
+			gotSmall, err := d.Get(ctx, smallKey)
+			if err != nil {
+				t.Fatalf("Get small after Rewrap: %v", err)
+			}
+			if !bytes.Equal(gotSmall, smallVal) {
+				t.Fatal("small object changed value across Rewrap")
+			}
+
+			gotBig, err := d.Get(ctx, bigKey)
+			if err != nil {
+				t.Fatalf("Get big after Rewrap: %v", err)
+			}
+			if !bytes.Equal(gotBig, bigVal) {
+				t.Fatal("large object changed value across Rewrap")
+			}
+
+			segsAfter, err := d.conn.ObjectNamesAll(ctx, d.segmentsContainer(), nil)
+			if err != nil {
+				t.Fatalf("listing segments after Rewrap: %v", err)
+			}
+			if len(segsAfter) != len(segsBefore) {
+				t.Fatalf("Rewrap left %d segments behind, want %d (old segments should be replaced, not orphaned)", len(segsAfter), len(segsBefore))
+			}
+		})
+	}
+}
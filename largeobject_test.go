@@ -0,0 +1,155 @@
+package swiftds
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+	swift "github.com/ncw/swift/v2"
+	"github.com/ncw/swift/v2/swifttest"
+)
+
+func TestLargeObjectDefaults(t *testing.T) {
+	s := &SwiftContainer{Config: &Config{}}
+
+	if got := s.largeObjectThreshold(); got != defaultLargeObjectThreshold {
+		t.Errorf("largeObjectThreshold() = %d, want %d", got, defaultLargeObjectThreshold)
+	}
+	if got := s.segmentSize(); got != defaultSegmentSize {
+		t.Errorf("segmentSize() = %d, want %d", got, defaultSegmentSize)
+	}
+
+	s.Config.LargeObjectThreshold = 123
+	s.Config.SegmentSize = 456
+	if got := s.largeObjectThreshold(); got != 123 {
+		t.Errorf("largeObjectThreshold() = %d, want 123", got)
+	}
+	if got := s.segmentSize(); got != 456 {
+		t.Errorf("segmentSize() = %d, want 456", got)
+	}
+}
+
+func TestSegmentsContainer(t *testing.T) {
+	s := &SwiftContainer{Config: &Config{Container: "mycontainer"}}
+
+	if got, want := s.segmentsContainer(), "mycontainer_segments"; got != want {
+		t.Errorf("segmentsContainer() = %q, want %q", got, want)
+	}
+}
+
+// newLargeObjectTestDS spins up an in-memory swifttest server (rather than
+// relying on newDS's real-Swift-account env vars) so putStaticLargeObject,
+// putDynamicLargeObject and deleteObject's manifest handling are exercised
+// without any external dependency.
+func newLargeObjectTestDS(t *testing.T, configure func(*Config)) (*SwiftContainer, func()) {
+	srv, err := swifttest.NewSwiftServer("localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	conf := &Config{
+		Connection: swift.Connection{
+			UserName: "swifttest",
+			ApiKey:   "swifttest",
+			AuthUrl:  srv.AuthURL,
+		},
+		Container:            "largeobject_test",
+		LargeObjectThreshold: 64,
+		SegmentSize:          16,
+	}
+	if configure != nil {
+		configure(conf)
+	}
+
+	if err := conf.Connection.Authenticate(ctx); err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	if err := conf.Connection.ContainerCreate(ctx, conf.Container, nil); err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+
+	d, err := NewSwiftDatastore(ctx, conf)
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+
+	return d, func() {
+		d.Close()
+		srv.Close()
+	}
+}
+
+func TestLargeObjectPutGetDelete(t *testing.T) {
+	for _, dynamic := range []bool{false, true} {
+		dynamic := dynamic
+		name := "static"
+		if dynamic {
+			name = "dynamic"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			d, done := newLargeObjectTestDS(t, func(c *Config) {
+				c.UseDynamicLargeObject = dynamic
+			})
+			defer done()
+
+			ctx := context.Background()
+			k := ds.NewKey("/bigobject")
+			val := make([]byte, 200)
+			if _, err := rand.Read(val); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := d.Put(ctx, k, val); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+
+			got, err := d.Get(ctx, k)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if !bytes.Equal(got, val) {
+				t.Fatal("large object round-trip produced different bytes")
+			}
+
+			size, err := d.GetSize(ctx, k)
+			if err != nil {
+				t.Fatalf("GetSize: %v", err)
+			}
+			if size != len(val) {
+				t.Fatalf("GetSize() = %d, want %d", size, len(val))
+			}
+
+			segs, err := d.conn.ObjectNamesAll(ctx, d.segmentsContainer(), nil)
+			if err != nil {
+				t.Fatalf("listing segments: %v", err)
+			}
+			if len(segs) == 0 {
+				t.Fatal("expected Put to have written segments")
+			}
+
+			if err := d.Delete(ctx, k); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+
+			if _, err := d.Get(ctx, k); err != ds.ErrNotFound {
+				t.Fatalf("Get after Delete = %v, want ds.ErrNotFound", err)
+			}
+
+			segs, err = d.conn.ObjectNamesAll(ctx, d.segmentsContainer(), nil)
+			if err != nil {
+				t.Fatalf("listing segments after Delete: %v", err)
+			}
+			if len(segs) != 0 {
+				t.Fatalf("Delete left %d orphaned segments behind", len(segs))
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package swiftds
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	swift "github.com/ncw/swift/v2"
+)
+
+const (
+	opGet         = "get"
+	opPut         = "put"
+	opDelete      = "delete"
+	opHas         = "has"
+	opGetSize     = "getsize"
+	opQueryPage   = "query_page"
+	opBulkUpload  = "bulk_upload"
+	opBulkDelete  = "bulk_delete"
+	opAuthRefresh = "auth_refresh"
+)
+
+// instrumentationName identifies this package as the source of spans and
+// metrics, so they can be told apart from the caller's own.
+const instrumentationName = "github.com/ipfs/go-ds-swift"
+
+// metricsCollector records per-operation counters and latency histograms.
+// It is safe to use with a nil Registerer: the vectors are still created
+// and updated, they're simply never exported.
+type metricsCollector struct {
+	opsTotal   *prometheus.CounterVec
+	opDuration *prometheus.HistogramVec
+}
+
+func newMetricsCollector(reg prometheus.Registerer) *metricsCollector {
+	m := &metricsCollector{
+		opsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "swiftds",
+			Name:      "operations_total",
+			Help:      "Number of Swift operations performed, labeled by operation and result.",
+		}, []string{"op", "result"}),
+		opDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "swiftds",
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of Swift operations, labeled by operation.",
+		}, []string{"op"}),
+	}
+
+	if reg != nil {
+		if err := reg.Register(m.opsTotal); err != nil {
+			// Another SwiftContainer sharing this Registerer already
+			// registered the same collector; reuse it so both instances'
+			// observations land in the one Gather sees, instead of silently
+			// discarding this instance's.
+			if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+				m.opsTotal = are.ExistingCollector.(*prometheus.CounterVec)
+			}
+		}
+		if err := reg.Register(m.opDuration); err != nil {
+			if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+				m.opDuration = are.ExistingCollector.(*prometheus.HistogramVec)
+			}
+		}
+	}
+
+	return m
+}
+
+func (m *metricsCollector) observe(op string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.opsTotal.WithLabelValues(op, result).Inc()
+	m.opDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+}
+
+// tracer returns the configured TracerProvider's tracer, falling back to
+// the global otel TracerProvider (a no-op until the caller installs one)
+// when Config.TracerProvider is unset.
+func (s *SwiftContainer) tracer() oteltrace.Tracer {
+	tp := s.Config.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(instrumentationName)
+}
+
+func (s *SwiftContainer) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, oteltrace.Span) {
+	attrs = append(attrs, attribute.String("container", s.Container))
+	return s.tracer().Start(ctx, name, oteltrace.WithAttributes(attrs...))
+}
+
+// recordSpanResult sets the span's status and, when err is itself a
+// *swift.Error (wrapped errors are not unwrapped), its swift.status_code
+// attribute.
+func recordSpanResult(span oteltrace.Span, err error) {
+	if err == nil {
+		span.SetStatus(codes.Ok, "")
+		return
+	}
+
+	span.SetStatus(codes.Error, err.Error())
+	if swiftErr, ok := err.(*swift.Error); ok {
+		span.SetAttributes(attribute.Int("swift.status_code", swiftErr.StatusCode))
+	}
+}
@@ -0,0 +1,72 @@
+package swiftds
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetricsCollectorNilRegisterer(t *testing.T) {
+	m := newMetricsCollector(nil)
+
+	m.observe(opGet, time.Now(), nil)
+	m.observe(opPut, time.Now(), errors.New("boom"))
+}
+
+func TestMetricsCollectorRegisters(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := newMetricsCollector(reg)
+
+	// A *Vec with no observed label combination yet doesn't surface in
+	// Gather, so record one before checking that registration happened.
+	m.observe(opGet, time.Now(), nil)
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := map[string]bool{}
+	for _, mf := range mfs {
+		names[mf.GetName()] = true
+	}
+
+	for _, want := range []string{"swiftds_operations_total", "swiftds_operation_duration_seconds"} {
+		if !names[want] {
+			t.Errorf("expected metric %q to be registered", want)
+		}
+	}
+}
+
+// TestMetricsCollectorSharedRegisterer covers two SwiftContainers sharing
+// one Registerer (e.g. two containers wired to the same process-wide
+// registry): the second collector must fall back to the first's already-
+// registered vectors rather than silently dropping its own observations.
+func TestMetricsCollectorSharedRegisterer(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m1 := newMetricsCollector(reg)
+	m2 := newMetricsCollector(reg)
+
+	m1.observe(opGet, time.Now(), nil)
+	m2.observe(opGet, time.Now(), nil)
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got float64
+	for _, mf := range mfs {
+		if mf.GetName() != "swiftds_operations_total" {
+			continue
+		}
+		for _, metric := range mf.GetMetric() {
+			got += metric.GetCounter().GetValue()
+		}
+	}
+	if got != 2 {
+		t.Errorf("total swiftds_operations_total samples = %v, want 2", got)
+	}
+}
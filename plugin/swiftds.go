@@ -1,13 +1,14 @@
 package plugin
 
 import (
+	"context"
 	"fmt"
 
 	swiftds "github.com/ipfs/go-ds-swift"
 	"github.com/ipfs/go-ipfs/plugin"
 	"github.com/ipfs/go-ipfs/repo"
 	"github.com/ipfs/go-ipfs/repo/fsrepo"
-	"github.com/ncw/swift"
+	swift "github.com/ncw/swift/v2"
 )
 
 var Plugins = []plugin.Plugin{
@@ -34,9 +35,12 @@ func (sp SwiftPlugin) DatastoreTypeName() string {
 
 func (sp SwiftPlugin) DatastoreConfigParser() fsrepo.ConfigFromMap {
 	return func(m map[string]interface{}) (fsrepo.DatastoreConfig, error) {
-		username, ok := m["userName"].(string)
-		if !ok {
-			return nil, fmt.Errorf("swiftds: no userName specified")
+		var username string
+		if v, ok := m["userName"]; ok {
+			username, ok = v.(string)
+			if !ok {
+				return nil, fmt.Errorf("swiftds: userName not a string")
+			}
 		}
 
 		container, ok := m["container"].(string)
@@ -44,9 +48,12 @@ func (sp SwiftPlugin) DatastoreConfigParser() fsrepo.ConfigFromMap {
 			return nil, fmt.Errorf("swiftds: no container specified")
 		}
 
-		apikey, ok := m["apiKey"].(string)
-		if !ok {
-			return nil, fmt.Errorf("swiftds: no apiKey specified")
+		var apikey string
+		if v, ok := m["apiKey"]; ok {
+			apikey, ok = v.(string)
+			if !ok {
+				return nil, fmt.Errorf("swiftds: apiKey not a string")
+			}
 		}
 
 		authUrl, ok := m["authUrl"].(string)
@@ -87,35 +94,128 @@ func (sp SwiftPlugin) DatastoreConfigParser() fsrepo.ConfigFromMap {
 			authVersion = int(f)
 		}
 
-		return &SwiftConfig{
-			cfg: swiftds.Config{
-				Connection: swift.Connection{
-					UserName:    username,
-					ApiKey:      apikey,
-					AuthUrl:     authUrl,
-					AuthVersion: authVersion,
-					Tenant:      tenant,
-					TenantId:    tenantId,
-					Region:      region,
-				},
-				Container: container,
+		var domain string
+		if v, ok := m["domain"]; ok {
+			domain, ok = v.(string)
+			if !ok {
+				return nil, fmt.Errorf("swiftds: domain not a string")
+			}
+		}
+
+		var domainId string
+		if v, ok := m["domainId"]; ok {
+			domainId, ok = v.(string)
+			if !ok {
+				return nil, fmt.Errorf("swiftds: domainId not a string")
+			}
+		}
+
+		var trustId string
+		if v, ok := m["trustId"]; ok {
+			trustId, ok = v.(string)
+			if !ok {
+				return nil, fmt.Errorf("swiftds: trustId not a string")
+			}
+		}
+
+		var appCredentialId string
+		if v, ok := m["applicationCredentialId"]; ok {
+			appCredentialId, ok = v.(string)
+			if !ok {
+				return nil, fmt.Errorf("swiftds: applicationCredentialId not a string")
+			}
+		}
+
+		var appCredentialName string
+		if v, ok := m["applicationCredentialName"]; ok {
+			appCredentialName, ok = v.(string)
+			if !ok {
+				return nil, fmt.Errorf("swiftds: applicationCredentialName not a string")
+			}
+		}
+
+		var appCredentialSecret string
+		if v, ok := m["applicationCredentialSecret"]; ok {
+			appCredentialSecret, ok = v.(string)
+			if !ok {
+				return nil, fmt.Errorf("swiftds: applicationCredentialSecret not a string")
+			}
+		}
+
+		var endpointType string
+		if v, ok := m["endpointType"]; ok {
+			endpointType, ok = v.(string)
+			if !ok {
+				return nil, fmt.Errorf("swiftds: endpointType not a string")
+			}
+		}
+
+		// userName/apiKey are only required when no application-credential
+		// fields are present; with one, Config.Validate below rejects an
+		// ambiguous mix of the two.
+		if appCredentialId == "" && appCredentialName == "" {
+			if username == "" {
+				return nil, fmt.Errorf("swiftds: no userName specified")
+			}
+			if apikey == "" {
+				return nil, fmt.Errorf("swiftds: no apiKey specified")
+			}
+		}
+
+		cfg := &swiftds.Config{
+			Connection: swift.Connection{
+				UserName:                    username,
+				ApiKey:                      apikey,
+				AuthUrl:                     authUrl,
+				AuthVersion:                 authVersion,
+				Tenant:                      tenant,
+				TenantId:                    tenantId,
+				Region:                      region,
+				Domain:                      domain,
+				DomainId:                    domainId,
+				TrustId:                     trustId,
+				ApplicationCredentialId:     appCredentialId,
+				ApplicationCredentialName:   appCredentialName,
+				ApplicationCredentialSecret: appCredentialSecret,
+				EndpointType:                swift.EndpointType(endpointType),
 			},
-		}, nil
+			Container: container,
+		}
+
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+
+		return &SwiftConfig{cfg: cfg}, nil
 	}
 }
 
 type SwiftConfig struct {
-	cfg swiftds.Config
+	cfg *swiftds.Config
 }
 
 func (sc *SwiftConfig) DiskSpec() fsrepo.DiskSpec {
-	return fsrepo.DiskSpec{
+	spec := fsrepo.DiskSpec{
 		"apiUrl":    sc.cfg.Connection.AuthUrl,
 		"container": sc.cfg.Container,
 		"tenant":    sc.cfg.Connection.Tenant,
 	}
+
+	// Only recorded when set, so that repos created before these fields
+	// existed don't see a spurious mismatch on every fsrepo.Open.
+	if sc.cfg.Connection.Domain != "" {
+		spec["domain"] = sc.cfg.Connection.Domain
+	}
+	if sc.cfg.Connection.ApplicationCredentialId != "" {
+		spec["applicationCredentialId"] = sc.cfg.Connection.ApplicationCredentialId
+	}
+	if sc.cfg.Connection.ApplicationCredentialName != "" {
+		spec["applicationCredentialName"] = sc.cfg.Connection.ApplicationCredentialName
+	}
+
+	return spec
 }
 
 func (sc *SwiftConfig) Create(path string) (repo.Datastore, error) {
-	return swiftds.NewSwiftDatastore(sc.cfg)
+	return swiftds.NewSwiftDatastore(context.TODO(), sc.cfg)
 }
@@ -7,18 +7,25 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	ds "github.com/ipfs/go-datastore"
 	dsq "github.com/ipfs/go-datastore/query"
 
-	swift "github.com/ncw/swift"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	swift "github.com/ncw/swift/v2"
 )
 
 type SwiftContainer struct {
-	conn  *swift.Connection
-	cache *QueryCache
+	conn      *swift.Connection
+	cache     *QueryCache
+	metrics   *metricsCollector
+	encryptor *encryptor
 
-	Config
+	*Config
 }
 
 type QueryCache struct {
@@ -37,24 +44,105 @@ func (c *QueryCache) Invalidate() {
 type Config struct {
 	swift.Connection
 	Container string
+
+	// LargeObjectThreshold is the value size, in bytes, at or above which
+	// Put streams the value into a segmented large object instead of a
+	// single PUT. Swift rejects objects larger than 5 GiB outright, so
+	// values at or above this threshold are split into SegmentSize
+	// chunks in a hidden "<Container>_segments" container. Defaults to
+	// 4 GiB when zero.
+	LargeObjectThreshold int64
+
+	// SegmentSize is the size, in bytes, of each segment written when a
+	// large object is created. Defaults to 1 GiB when zero.
+	SegmentSize int64
+
+	// UseDynamicLargeObject selects Dynamic Large Objects (a manifest
+	// object carrying an X-Object-Manifest header) for values at or
+	// above LargeObjectThreshold. The default is Static Large Objects
+	// (an explicit, ETag-verified manifest), which Swift can delete
+	// atomically alongside their segments.
+	UseDynamicLargeObject bool
+
+	// MetricsRegisterer, if set, receives the swiftds_operations_total
+	// counter and swiftds_operation_duration_seconds histogram. They
+	// record the authentication in NewSwiftDatastore, each Get, Put,
+	// Delete, Has and GetSize, each listing page fetched by Query, and a
+	// batch's bulk upload and bulk delete. DiskUsage, Rewrap and the
+	// object fetches inside Query are not recorded. Nil-safe: operations
+	// are still timed internally when unset, they're just never exported.
+	MetricsRegisterer prometheus.Registerer
+
+	// TracerProvider, if set, is used to start a span (e.g. "swiftds.Get")
+	// around Get, Put, Delete, Has, GetSize and Batch.Commit, nested under
+	// the incoming ctx so it appears under the caller's own trace. Query,
+	// DiskUsage and Rewrap start no span. Defaults to the global otel
+	// TracerProvider when unset.
+	TracerProvider oteltrace.TracerProvider
+
+	// Encryption, if set, transparently encrypts object contents with a
+	// client-side key before every Put and decrypts them on every Get
+	// and Query. See EncryptionConfig.
+	Encryption EncryptionConfig
 }
 
-func NewSwiftDatastore(conf Config) (*SwiftContainer, error) {
+// Validate rejects Config combinations that would leave the underlying
+// swift.Connection with an ambiguous set of credentials, catching
+// misconfiguration before it reaches Authenticate.
+func (conf *Config) Validate() error {
+	hasPassword := conf.Connection.ApiKey != ""
+	hasAppCredential := conf.Connection.ApplicationCredentialId != "" || conf.Connection.ApplicationCredentialName != ""
+
+	if hasPassword && hasAppCredential {
+		return fmt.Errorf("swiftds: ApiKey and ApplicationCredential* are mutually exclusive")
+	}
+
+	if hasAppCredential && conf.Connection.ApplicationCredentialSecret == "" {
+		return fmt.Errorf("swiftds: ApplicationCredentialSecret is required when using application credentials")
+	}
+
+	if conf.Connection.ApplicationCredentialName != "" && conf.Connection.ApplicationCredentialId == "" && conf.Connection.UserName == "" {
+		return fmt.Errorf("swiftds: ApplicationCredentialName requires UserName (or use ApplicationCredentialId instead)")
+	}
+
+	return nil
+}
+
+func NewSwiftDatastore(ctx context.Context, conf *Config) (*SwiftContainer, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	// conn aliases conf.Connection (rather than copying it) so that s.conn
+	// and s.Config.Connection always observe the same auth token, storage
+	// URL and authLock: a copy of swift.Connection carries a copy of its
+	// sync.Mutex, and the two would silently drift out of sync on reauth.
 	c := &conf.Connection
+	m := newMetricsCollector(conf.MetricsRegisterer)
+
+	start := time.Now()
+	err := c.Authenticate(ctx)
+	m.observe(opAuthRefresh, start, err)
+	if err != nil {
+		return nil, err
+	}
 
-	if err := c.Authenticate(); err != nil {
+	_, _, err = c.Container(ctx, conf.Container)
+	if err != nil {
 		return nil, err
 	}
 
-	_, _, err := c.Container(conf.Container)
+	enc, err := newEncryptor(conf.Encryption)
 	if err != nil {
 		return nil, err
 	}
 
 	return &SwiftContainer{
-		conn:   c,
-		cache:  &QueryCache{},
-		Config: conf,
+		conn:      c,
+		cache:     &QueryCache{},
+		metrics:   m,
+		encryptor: enc,
+		Config:    conf,
 	}, nil
 }
 
@@ -64,62 +152,146 @@ func keyToName(k ds.Key) string {
 	return strings.TrimPrefix(k.String(), "/")
 }
 
-func (s *SwiftContainer) Get(ctx context.Context, k ds.Key) ([]byte, error) {
-	data, err := s.conn.ObjectGetBytes(s.Container, keyToName(k))
+// Get fetches the object's contents, transparently decrypting it when
+// Config.Encryption applies. Swift resolves both DLO and SLO manifests
+// server-side, so a large object's segments are reassembled transparently
+// and no special-casing is needed here.
+func (s *SwiftContainer) Get(ctx context.Context, k ds.Key) (_ []byte, err error) {
+	ctx, span := s.startSpan(ctx, "swiftds.Get", attribute.String("key", k.String()))
+	start := time.Now()
+	defer func() {
+		recordSpanResult(span, err)
+		span.End()
+		s.metrics.observe(opGet, start, err)
+	}()
+
+	data, err := s.getObject(ctx, keyToName(k))
 	switch err {
 	case nil:
+		span.SetAttributes(attribute.Int("bytes", len(data)))
 		return data, nil
 	case swift.ObjectNotFound:
-		return nil, ds.ErrNotFound
+		err = ds.ErrNotFound
+		return nil, err
 	default:
 		return nil, err
 	}
 }
 
-func (s *SwiftContainer) Delete(ctx context.Context, k ds.Key) error {
+func (s *SwiftContainer) Delete(ctx context.Context, k ds.Key) (err error) {
 	s.cache.Invalidate()
-	return s.conn.ObjectDelete(s.Container, keyToName(k))
+
+	ctx, span := s.startSpan(ctx, "swiftds.Delete", attribute.String("key", k.String()))
+	start := time.Now()
+	defer func() {
+		recordSpanResult(span, err)
+		span.End()
+		s.metrics.observe(opDelete, start, err)
+	}()
+
+	err = s.deleteObject(ctx, keyToName(k))
+	return err
 }
 
-func (s *SwiftContainer) Put(ctx context.Context, k ds.Key, val []byte) error {
+func (s *SwiftContainer) Put(ctx context.Context, k ds.Key, val []byte) (err error) {
 	s.cache.Invalidate()
-	return s.conn.ObjectPutBytes(s.Container, keyToName(k), val, "application/octet-stream")
+
+	ctx, span := s.startSpan(ctx, "swiftds.Put", attribute.String("key", k.String()), attribute.Int("bytes", len(val)))
+	start := time.Now()
+	defer func() {
+		recordSpanResult(span, err)
+		span.End()
+		s.metrics.observe(opPut, start, err)
+	}()
+
+	if s.encryptor != nil {
+		val, err = s.encryptor.seal(val)
+		if err != nil {
+			return err
+		}
+	}
+
+	if int64(len(val)) >= s.largeObjectThreshold() {
+		err = s.putLargeObject(ctx, keyToName(k), val)
+		return err
+	}
+
+	if s.encryptor != nil {
+		_, err = s.conn.ObjectPut(ctx, s.Container, keyToName(k), bytes.NewReader(val), false, "", "application/octet-stream", s.encryptor.header())
+		return err
+	}
+
+	err = s.conn.ObjectPutBytes(ctx, s.Container, keyToName(k), val, "application/octet-stream")
+	return err
 }
 
-func (s *SwiftContainer) Has(ctx context.Context, k ds.Key) (bool, error) {
-	_, _, err := s.conn.Object(s.Container, keyToName(k))
+func (s *SwiftContainer) Has(ctx context.Context, k ds.Key) (_ bool, err error) {
+	ctx, span := s.startSpan(ctx, "swiftds.Has", attribute.String("key", k.String()))
+	start := time.Now()
+	defer func() {
+		recordSpanResult(span, err)
+		span.End()
+		s.metrics.observe(opHas, start, err)
+	}()
+
+	_, _, err = s.conn.Object(ctx, s.Container, keyToName(k))
 	switch err {
 	case nil:
 		return true, nil
 	case swift.ObjectNotFound:
+		err = nil
 		return false, nil
 	default:
 		return false, err
 	}
 }
 
-func (s *SwiftContainer) GetSize(ctx context.Context, k ds.Key) (int, error) {
-	info, _, err := s.conn.Object(s.Container, keyToName(k))
+// GetSize returns the object's total size. As with Get, Swift reports the
+// combined size of a large object's segments on the manifest itself, so
+// DLO and SLO objects need no extra handling. When the object is
+// encrypted, the nonce and authentication tag are subtracted so callers
+// see the plaintext size rather than the size on the wire.
+func (s *SwiftContainer) GetSize(ctx context.Context, k ds.Key) (_ int, err error) {
+	ctx, span := s.startSpan(ctx, "swiftds.GetSize", attribute.String("key", k.String()))
+	start := time.Now()
+	defer func() {
+		recordSpanResult(span, err)
+		span.End()
+		s.metrics.observe(opGetSize, start, err)
+	}()
+
+	info, headers, err := s.conn.Object(ctx, s.Container, keyToName(k))
 
 	if err != nil {
 		switch err {
 		case swift.ObjectNotFound:
-			return 0, ds.ErrNotFound
+			err = ds.ErrNotFound
+			return 0, err
 		default:
 			return 0, err
 		}
 	}
 
+	if _, _, ok := parseEncHeader(headers); ok {
+		if s.encryptor == nil {
+			err = fmt.Errorf("swiftds: object is encrypted but Config.Encryption is not set")
+			return 0, err
+		}
+		info.Bytes -= int64(s.encryptor.overhead())
+	}
+
 	maxInt := int64((^uint(0)) >> 1)
 	if info.Bytes > maxInt {
-		return 0, fmt.Errorf("integer overflow")
+		err = fmt.Errorf("integer overflow")
+		return 0, err
 	}
+	span.SetAttributes(attribute.Int64("bytes", info.Bytes))
 	return int(info.Bytes), nil
 }
 
 func (s *SwiftContainer) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
 	if q.Orders != nil || q.Filters != nil {
-		return nil, fmt.Errorf("swiftds doesnt support filters or orders")
+		return s.queryFiltered(ctx, q)
 	}
 
 	opts := swift.ObjectsOpts{
@@ -154,6 +326,10 @@ func (s *SwiftContainer) Query(ctx context.Context, q dsq.Query) (dsq.Results, e
 			return nil
 		},
 		Next: func() (dsq.Result, bool) {
+			if err := ctx.Err(); err != nil {
+				return dsq.Result{Error: err}, false
+			}
+
 			if q.Limit != 0 && count == q.Limit {
 				return dsq.Result{}, false
 			}
@@ -163,7 +339,13 @@ func (s *SwiftContainer) Query(ctx context.Context, q dsq.Query) (dsq.Results, e
 					return dsq.Result{}, false
 				}
 
-				newNames, err := s.conn.ObjectNames(s.Container, &opts)
+				if err := ctx.Err(); err != nil {
+					return dsq.Result{Error: err}, false
+				}
+
+				pageStart := time.Now()
+				newNames, err := s.conn.ObjectNames(ctx, s.Container, &opts)
+				s.metrics.observe(opQueryPage, pageStart, err)
 				if err != nil {
 					return dsq.Result{Error: err}, false
 				}
@@ -215,7 +397,7 @@ func (s *SwiftContainer) Query(ctx context.Context, q dsq.Query) (dsq.Results, e
 				return dsq.Result{Entry: dsq.Entry{Key: key}}, true
 			}
 
-			b, err := s.conn.ObjectGetBytes(s.Container, name)
+			b, err := s.getObject(ctx, name)
 			if err != nil {
 				return dsq.Result{Error: err}, false
 			}
@@ -224,6 +406,147 @@ func (s *SwiftContainer) Query(ctx context.Context, q dsq.Query) (dsq.Results, e
 	}), nil
 }
 
+// queryFiltered handles queries with Filters and/or Orders set. The naive
+// helpers in go-datastore/query need to see every matching entry before they
+// can filter, sort, offset or limit, so we list the whole (server-side
+// Prefix-restricted) keyspace and apply them client-side. The query-position
+// cache is intentionally left untouched here, since the naive listing
+// doesn't follow the marker-based paging the cache assumes.
+func (s *SwiftContainer) queryFiltered(ctx context.Context, q dsq.Query) (dsq.Results, error) {
+	opts := swift.ObjectsOpts{
+		Prefix: strings.TrimPrefix(q.Prefix, "/"),
+		// Number of entries to fetch at once
+		Limit: 10000,
+	}
+
+	// dsq.FilterValueCompare and dsq.OrderByValue/OrderByValueDescending all
+	// inspect Entry.Value, so none of them can be satisfied by the key-only
+	// entries the base iterator below produces; fetch values eagerly, before
+	// NaiveFilter/NaiveOrder run, whenever one of them is present.
+	needsValue := false
+	for _, f := range q.Filters {
+		if _, ok := f.(dsq.FilterValueCompare); ok {
+			needsValue = true
+			break
+		}
+	}
+	if !needsValue {
+		for _, o := range q.Orders {
+			switch o.(type) {
+			case dsq.OrderByValue, dsq.OrderByValueDescending:
+				needsValue = true
+			}
+			if needsValue {
+				break
+			}
+		}
+	}
+
+	names := []string{}
+	doneFetching := false
+
+	naiveQuery := q
+	naiveQuery.Prefix = ""
+	naiveQuery.Offset = 0
+	naiveQuery.Limit = 0
+	naiveQuery.Orders = nil
+	naiveQuery.Filters = nil
+
+	qr := dsq.ResultsFromIterator(naiveQuery, dsq.Iterator{
+		Close: func() error {
+			names = []string{}
+			return nil
+		},
+		Next: func() (dsq.Result, bool) {
+			if err := ctx.Err(); err != nil {
+				return dsq.Result{Error: err}, false
+			}
+
+			for len(names) == 0 {
+				if doneFetching {
+					return dsq.Result{}, false
+				}
+
+				pageStart := time.Now()
+				newNames, err := s.conn.ObjectNames(ctx, s.Container, &opts)
+				s.metrics.observe(opQueryPage, pageStart, err)
+				if err != nil {
+					return dsq.Result{Error: err}, false
+				}
+
+				if len(newNames) < opts.Limit {
+					doneFetching = true
+				}
+				if len(newNames) == 0 {
+					return dsq.Result{}, false
+				}
+
+				opts.Marker = newNames[len(newNames)-1]
+				names = append(names, newNames...)
+			}
+
+			name := names[0]
+			names = names[1:]
+
+			entry := dsq.Entry{Key: "/" + name}
+			if needsValue {
+				b, err := s.getObject(ctx, name)
+				if err != nil {
+					return dsq.Result{Error: err}, false
+				}
+				entry.Value = b
+			}
+
+			return dsq.Result{Entry: entry}, true
+		},
+	})
+
+	for _, f := range q.Filters {
+		qr = dsq.NaiveFilter(qr, f)
+	}
+	if len(q.Orders) > 0 {
+		qr = dsq.NaiveOrder(qr, q.Orders...)
+	}
+	if q.Offset != 0 {
+		qr = dsq.NaiveOffset(qr, q.Offset)
+	}
+	if q.Limit != 0 {
+		qr = dsq.NaiveLimit(qr, q.Limit)
+	}
+
+	if q.KeysOnly {
+		return qr, nil
+	}
+
+	if needsValue {
+		// Values were already fetched above to make the filter work, so the
+		// survivors can be returned as-is.
+		return qr, nil
+	}
+
+	// Only fetch values for the entries that survived filtering/ordering,
+	// so we never download an object we're about to discard.
+	return dsq.ResultsFromIterator(q, dsq.Iterator{
+		Close: qr.Close,
+		Next: func() (dsq.Result, bool) {
+			e, ok := qr.NextSync()
+			if !ok {
+				return dsq.Result{}, false
+			}
+			if e.Error != nil {
+				return e, true
+			}
+
+			b, err := s.getObject(ctx, strings.TrimPrefix(e.Key, "/"))
+			if err != nil {
+				return dsq.Result{Error: err}, false
+			}
+			e.Value = b
+			return dsq.Result{Entry: e.Entry}, true
+		},
+	}), nil
+}
+
 func (s *SwiftContainer) Sync(ctx context.Context, prefix ds.Key) error {
 	return nil
 }
@@ -232,12 +555,23 @@ func (s *SwiftContainer) Close() error {
 	return nil
 }
 
-func (s *SwiftContainer) DiskUsage() (uint64, error) {
-	c, _, err := s.conn.Container(s.Container)
+func (s *SwiftContainer) DiskUsage(ctx context.Context) (uint64, error) {
+	c, _, err := s.conn.Container(ctx, s.Container)
 	if err != nil {
 		return 0, err
 	}
-	return uint64(c.Bytes), nil
+	total := uint64(c.Bytes)
+
+	segs, _, err := s.conn.Container(ctx, s.segmentsContainer())
+	switch err {
+	case nil:
+		total += uint64(segs.Bytes)
+	case swift.ContainerNotFound:
+	default:
+		return 0, err
+	}
+
+	return total, nil
 }
 
 func (s *SwiftContainer) Batch(ctx context.Context) (ds.Batch, error) {
@@ -257,6 +591,18 @@ type swiftBatch struct {
 }
 
 func (b *swiftBatch) Put(ctx context.Context, k ds.Key, val []byte) error {
+	// Large objects can't ride along in the batch's tar upload, so they're
+	// segmented and uploaded immediately, outside the batch. Encrypted
+	// entries go out immediately too: the tar bulk-upload path has no way
+	// to carry a per-object header atomically with the write, and a crash
+	// between BulkUpload and a follow-up header-attach call would leave
+	// ciphertext with no encHeaderName header — which maybeDecrypt can't
+	// tell apart from plaintext. Put handles encryption and large-object
+	// segmenting on its own.
+	if int64(len(val)) >= b.s.largeObjectThreshold() || b.s.encryptor != nil {
+		return b.s.Put(ctx, k, val)
+	}
+
 	if b.tarWriter == nil {
 		b.putData = new(bytes.Buffer)
 		b.tarWriter = tar.NewWriter(b.putData)
@@ -281,7 +627,42 @@ func (b *swiftBatch) Delete(ctx context.Context, k ds.Key) error {
 	return nil
 }
 
-func (b *swiftBatch) Commit(ctx context.Context) error {
+// bulkDeleteNames splits delKeys into names that are safe to hand to Swift's
+// BulkDelete (which only ever removes the named object, orphaning a large
+// object's segments in segmentsContainer forever) and large-object names
+// that must instead go through LargeObjectDelete so the manifest and its
+// segments are removed atomically, exactly as the non-batched Delete does
+// via deleteObject.
+func (b *swiftBatch) bulkDeleteNames(ctx context.Context) (bulkNames []string, err error) {
+	for _, name := range b.delKeys {
+		_, headers, err := b.s.conn.Object(ctx, b.s.Container, name)
+		switch err {
+		case nil:
+		case swift.ObjectNotFound:
+			continue
+		default:
+			return nil, err
+		}
+
+		if headers.IsLargeObject() {
+			if err := b.s.conn.LargeObjectDelete(ctx, b.s.Container, name); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		bulkNames = append(bulkNames, name)
+	}
+	return bulkNames, nil
+}
+
+func (b *swiftBatch) Commit(ctx context.Context) (err error) {
+	ctx, span := b.s.startSpan(ctx, "swiftds.Batch.Commit")
+	defer func() {
+		recordSpanResult(span, err)
+		span.End()
+	}()
+
 	b.s.cache.Invalidate()
 
 	if b.tarWriter != nil {
@@ -289,19 +670,36 @@ func (b *swiftBatch) Commit(ctx context.Context) error {
 			return err
 		}
 
-		_, err := b.s.BulkUpload(b.s.Container, b.putData, swift.UploadTar, nil)
+		span.SetAttributes(attribute.Int("tar_upload_bytes", b.putData.Len()))
+
+		start := time.Now()
+		_, err := b.s.BulkUpload(ctx, b.s.Container, b.putData, swift.UploadTar, nil)
+		b.s.metrics.observe(opBulkUpload, start, err)
 		if err != nil {
 			return err
 		}
 	}
 
 	if len(b.delKeys) > 0 {
-		if _, err := b.s.BulkDelete(b.s.Container, b.delKeys); err != nil {
+		span.SetAttributes(attribute.Int("deleted_keys", len(b.delKeys)))
+
+		bulkNames, err := b.bulkDeleteNames(ctx)
+		if err != nil {
 			return err
 		}
+
+		if len(bulkNames) > 0 {
+			start := time.Now()
+			_, err := b.s.BulkDelete(ctx, b.s.Container, bulkNames)
+			b.s.metrics.observe(opBulkDelete, start, err)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
 var _ ds.Batching = (*SwiftContainer)(nil)
+var _ ds.PersistentDatastore = (*SwiftContainer)(nil)
@@ -12,6 +12,8 @@ import (
 
 	ds "github.com/ipfs/go-datastore"
 	dsq "github.com/ipfs/go-datastore/query"
+
+	swift "github.com/ncw/swift/v2"
 )
 
 var testcases = map[string]string{
@@ -32,7 +34,9 @@ var testcases = map[string]string{
 //	d, close := newDS(t)
 //	defer close()
 func newDS(t *testing.T) (*SwiftContainer, func()) {
-	conf := Config{}
+	ctx := context.Background()
+
+	conf := &Config{}
 
 	conf.AuthUrl = os.Getenv("SDS_URL")
 	conf.TenantId = os.Getenv("SDS_TENANT_ID")
@@ -48,12 +52,12 @@ func newDS(t *testing.T) (*SwiftContainer, func()) {
 
 	conf.Container = "swiftds_test"
 
-	d, err := NewSwiftDatastore(conf)
+	d, err := NewSwiftDatastore(ctx, conf)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	objs, err := d.Connection.Objects(conf.Container, nil)
+	objs, err := d.Connection.Objects(ctx, conf.Container, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -63,7 +67,7 @@ func newDS(t *testing.T) (*SwiftContainer, func()) {
 		sobjs[i] = o.Name
 	}
 
-	_, err = d.Connection.BulkDelete(conf.Container, sobjs)
+	_, err = d.Connection.BulkDelete(ctx, conf.Container, sobjs)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -98,6 +102,66 @@ func addTestCases(t *testing.T, d *SwiftContainer, testcases map[string]string)
 		}
 	}
 }
+func TestConfigValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		conf    Config
+		wantErr bool
+	}{
+		{
+			name: "password auth",
+			conf: Config{Connection: swift.Connection{UserName: "alice", ApiKey: "secret"}},
+		},
+		{
+			name: "application credential by id",
+			conf: Config{Connection: swift.Connection{
+				ApplicationCredentialId:     "cred-id",
+				ApplicationCredentialSecret: "cred-secret",
+			}},
+		},
+		{
+			name: "application credential by name",
+			conf: Config{Connection: swift.Connection{
+				UserName:                    "alice",
+				Domain:                      "default",
+				ApplicationCredentialName:   "cred-name",
+				ApplicationCredentialSecret: "cred-secret",
+			}},
+		},
+		{
+			name:    "application credential by name without UserName",
+			conf:    Config{Connection: swift.Connection{ApplicationCredentialName: "cred-name", ApplicationCredentialSecret: "cred-secret"}},
+			wantErr: true,
+		},
+		{
+			name:    "application credential missing secret",
+			conf:    Config{Connection: swift.Connection{ApplicationCredentialId: "cred-id"}},
+			wantErr: true,
+		},
+		{
+			name: "application credential alongside password is rejected",
+			conf: Config{Connection: swift.Connection{
+				ApiKey:                      "secret",
+				ApplicationCredentialId:     "cred-id",
+				ApplicationCredentialSecret: "cred-secret",
+			}},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.conf.Validate()
+			if tc.wantErr && err == nil {
+				t.Fatal("expected an error, got nil")
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
 func TestQuery(t *testing.T) {
 	ctx := context.Background()
 
@@ -164,6 +228,135 @@ func TestQuery(t *testing.T) {
 	}, rs)
 }
 
+func TestQueryFilterOrder(t *testing.T) {
+	ctx := context.Background()
+
+	d, done := newDS(t)
+	defer done()
+
+	addTestCases(t, d, testcases)
+
+	rs, err := d.Query(ctx, dsq.Query{
+		Prefix:  "/a/",
+		Filters: []dsq.Filter{dsq.FilterKeyPrefix{Prefix: "/a/b"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectMatches(t, []string{
+		"/a/b",
+		"/a/b/c",
+		"/a/b/d",
+	}, rs)
+
+	rs, err = d.Query(ctx, dsq.Query{
+		Prefix: "/a/",
+		Orders: []dsq.Order{dsq.OrderByKeyDescending{}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := rs.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedOrder := []string{"/a/d", "/a/c", "/a/b/d", "/a/b/c", "/a/b"}
+	if len(res) != len(expectedOrder) {
+		t.Fatalf("expected %d results, got %d", len(expectedOrder), len(res))
+	}
+	for i, k := range expectedOrder {
+		if res[i].Key != k {
+			t.Errorf("result %d: expected %s, got %s", i, k, res[i].Key)
+		}
+		if string(res[i].Value) != testcases[k] {
+			t.Errorf("result %d: expected value %s, got %s", i, testcases[k], res[i].Value)
+		}
+	}
+}
+
+func TestQueryFilterValueCompare(t *testing.T) {
+	ctx := context.Background()
+
+	d, done := newDS(t)
+	defer done()
+
+	addTestCases(t, d, testcases)
+
+	rs, err := d.Query(ctx, dsq.Query{
+		Prefix:  "/a/",
+		Filters: []dsq.Filter{dsq.FilterValueCompare{Op: dsq.Equal, Value: []byte("ab")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectMatches(t, []string{"/a/b"}, rs)
+}
+
+func TestQueryOrderByValue(t *testing.T) {
+	ctx := context.Background()
+
+	d, done := newDS(t)
+	defer done()
+
+	addTestCases(t, d, testcases)
+
+	rs, err := d.Query(ctx, dsq.Query{
+		Prefix: "/a/",
+		Orders: []dsq.Order{dsq.OrderByValue{}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := rs.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedOrder := []string{"/a/b/d", "/a/b", "/a/b/c", "/a/c", "/a/d"}
+	if len(res) != len(expectedOrder) {
+		t.Fatalf("expected %d results, got %d", len(expectedOrder), len(res))
+	}
+	for i, k := range expectedOrder {
+		if res[i].Key != k {
+			t.Errorf("result %d: expected %s, got %s", i, k, res[i].Key)
+		}
+	}
+}
+
+// TestContextCancellation covers the chunk0-1 motivation for threading
+// context.Context through every operation: a caller must be able to cancel
+// a stalled Swift call instead of blocking forever.
+func TestContextCancellation(t *testing.T) {
+	d, done := newLargeObjectTestDS(t, nil)
+	defer done()
+
+	k := ds.NewKey("/cancelled")
+	if err := d.Put(context.Background(), k, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := d.Get(ctx, k); err == nil {
+		t.Fatal("expected Get with an already-cancelled context to fail")
+	}
+
+	rs, err := d.Query(ctx, dsq.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, _ := rs.NextSync()
+	if res.Error == nil {
+		t.Fatal("expected Query's first result with an already-cancelled context to report an error")
+	}
+}
+
 func expectCache(t *testing.T, d *SwiftContainer, prefix string, name string, index int) {
 	cprefix := "/" + d.cache.prefix
 	if cprefix != prefix {